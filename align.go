@@ -0,0 +1,162 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// alignOffset finds the translation (dx, dy) of imgB that best overlays it
+// onto imgA, searching up to maxOffset pixels in every direction. Screenshots
+// and PDF-rendered pages often shift by a handful of pixels between renders;
+// diffing them as-is produces a wall of false positives along every edge.
+//
+// The search runs coarse-to-fine over an image pyramid (built by halving
+// resolution log2(maxOffset) times) so an exhaustive search only has to
+// happen once, cheaply, at the coarsest level; every finer level then only
+// needs to refine the previous level's answer by +/-1 pixel.
+func alignOffset(imgA, imgB image.Image, maxOffset int) (dx, dy int) {
+	if maxOffset <= 0 {
+		return 0, 0
+	}
+
+	levels := pyramidLevels(maxOffset)
+
+	pyramidA := buildPyramid(toGray(imgA), levels)
+	pyramidB := buildPyramid(toGray(imgB), levels)
+
+	coarseRadius := maxOffset >> uint(levels)
+	if coarseRadius < 1 {
+		coarseRadius = 1
+	}
+	dx, dy = refineOffset(pyramidA[levels], pyramidB[levels], 0, 0, coarseRadius)
+
+	for level := levels - 1; level >= 0; level-- {
+		dx *= 2
+		dy *= 2
+		dx, dy = refineOffset(pyramidA[level], pyramidB[level], dx, dy, 1)
+	}
+
+	return dx, dy
+}
+
+// pyramidLevels returns the number of halvings needed before a single step
+// covers the requested search window, i.e. ceil(log2(maxOffset)).
+func pyramidLevels(maxOffset int) int {
+	levels := 0
+	for (1 << uint(levels)) < maxOffset {
+		levels++
+	}
+	return levels
+}
+
+// translateImage returns a copy of img registered onto the image alignOffset
+// compared it against: out(x, y) = img(x+dx, y+dy), cropped to the original
+// bounds, with pixels shifted in from outside the source left zeroed.
+func translateImage(img image.Image, dx, dy int) image.Image {
+	bounds := img.Bounds()
+	out := image.NewRGBA(bounds)
+	sp := bounds.Min.Add(image.Pt(dx, dy))
+	draw.Draw(out, bounds, img, sp, draw.Src)
+	return out
+}
+
+// -------------------------------------------------------------------------------------------------------------------------------------------------------------
+
+// grayImage is a minimal 8-bit grayscale buffer used by the alignment search;
+// it avoids the overhead of color.Color conversions on every SAD comparison.
+type grayImage struct {
+	pix  []uint8
+	w, h int
+}
+
+func toGray(img image.Image) *grayImage {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	g := &grayImage{pix: make([]uint8, w*h), w: w, h: h}
+
+	i := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			g.pix[i] = color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y
+			i++
+		}
+	}
+	return g
+}
+
+func (g *grayImage) at(x, y int) uint8 {
+	if x < 0 || y < 0 || x >= g.w || y >= g.h {
+		return 0
+	}
+	return g.pix[y*g.w+x]
+}
+
+// downscale2x averages each 2x2 block into a single pixel.
+func downscale2x(g *grayImage) *grayImage {
+	w, h := (g.w+1)/2, (g.h+1)/2
+	out := &grayImage{pix: make([]uint8, w*h), w: w, h: h}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sum := int(g.at(2*x, 2*y)) + int(g.at(2*x+1, 2*y)) + int(g.at(2*x, 2*y+1)) + int(g.at(2*x+1, 2*y+1))
+			out.pix[y*w+x] = uint8(sum / 4)
+		}
+	}
+	return out
+}
+
+// buildPyramid returns levels+1 grayscale images, index 0 at full resolution
+// and each subsequent index half the resolution of the last.
+func buildPyramid(g *grayImage, levels int) []*grayImage {
+	pyramid := make([]*grayImage, levels+1)
+	pyramid[0] = g
+	for i := 1; i <= levels; i++ {
+		pyramid[i] = downscale2x(pyramid[i-1])
+	}
+	return pyramid
+}
+
+// refineOffset exhaustively searches the square of the given radius around
+// (centerX, centerY) for the offset that minimizes the sum of absolute
+// differences between a and b.
+func refineOffset(a, b *grayImage, centerX, centerY, radius int) (int, int) {
+	bestDx, bestDy := centerX, centerY
+	bestScore := -1
+
+	for dy := centerY - radius; dy <= centerY+radius; dy++ {
+		for dx := centerX - radius; dx <= centerX+radius; dx++ {
+			score := sumAbsDiff(a, b, dx, dy)
+			if bestScore < 0 || score < bestScore {
+				bestScore = score
+				bestDx, bestDy = dx, dy
+			}
+		}
+	}
+
+	return bestDx, bestDy
+}
+
+// sumAbsDiff scores how well b overlays a when b is shifted by (dx, dy),
+// over just the region where the two overlap.
+func sumAbsDiff(a, b *grayImage, dx, dy int) int {
+	sum := 0
+	for y := 0; y < a.h; y++ {
+		by := y + dy
+		if by < 0 || by >= b.h {
+			continue
+		}
+		for x := 0; x < a.w; x++ {
+			bx := x + dx
+			if bx < 0 || bx >= b.w {
+				continue
+			}
+			d := int(a.pix[y*a.w+x]) - int(b.pix[by*b.w+bx])
+			if d < 0 {
+				d = -d
+			}
+			sum += d
+		}
+	}
+	return sum
+}
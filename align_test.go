@@ -0,0 +1,48 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// TestAlignOffsetAndTranslate diffs two images where B's content is shifted
+// by a known offset from A's, and checks that translating B by the offset
+// alignOffset reports puts it back into registration with A. A sign error in
+// either function would leave the feature at the wrong place (or twice as
+// far away), not merely off by a pixel, so an exact match is expected.
+func TestAlignOffsetAndTranslate(t *testing.T) {
+	const w, h = 40, 40
+	const shiftX, shiftY = 5, 2
+
+	imgA := image.NewGray(image.Rect(0, 0, w, h))
+	imgB := image.NewGray(image.Rect(0, 0, w, h))
+
+	paintSquare(imgA, 10, 10, 255)
+	paintSquare(imgB, 10+shiftX, 10+shiftY, 255)
+
+	dx, dy := alignOffset(imgA, imgB, 8)
+	if dx != shiftX || dy != shiftY {
+		t.Fatalf("alignOffset = (%d, %d), want (%d, %d)", dx, dy, shiftX, shiftY)
+	}
+
+	aligned := translateImage(imgB, dx, dy)
+
+	for y := 5; y < 35; y++ {
+		for x := 5; x < 35; x++ {
+			wantR, wantG, wantB, wantA := imgA.At(x, y).RGBA()
+			gotR, gotG, gotB, gotA := aligned.At(x, y).RGBA()
+			if gotR != wantR || gotG != wantG || gotB != wantB || gotA != wantA {
+				t.Fatalf("aligned(%d,%d) = %v, want %v (registration failed)", x, y, aligned.At(x, y), imgA.At(x, y))
+			}
+		}
+	}
+}
+
+func paintSquare(img *image.Gray, x0, y0 int, v uint8) {
+	for y := y0; y < y0+10; y++ {
+		for x := x0; x < x0+10; x++ {
+			img.SetGray(x, y, color.Gray{Y: v})
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// DiffResult carries a highlighted diff image plus the metrics gathered
+// while producing it. Not every field applies to every algorithm: MeanDeltaE
+// is only populated by LabDiffer and Hamming only by HashDiffer.
+type DiffResult struct {
+	Image      image.Image
+	PixelDiff  int
+	MeanDeltaE float64
+	Hamming    int
+}
+
+// Differ compares two equally-sized images and produces a highlighted diff
+// image along with the metrics describing how different they are.
+type Differ interface {
+	Diff(imgA, imgB image.Image) DiffResult
+}
+
+// NewDiffer builds the Differ selected by the -algo flag. mode selects the
+// CIELAB distance formula ("76" or "2000") when algo is "lab"; hash selects
+// the perceptual hash ("ahash", "dhash" or "phash") when algo is "phash".
+func NewDiffer(algo string, epsilon int, mode, hash string, highlight color.RGBA) (Differ, error) {
+	switch algo {
+	case "pixel", "":
+		return &PixelDiffer{Epsilon: epsilon, Highlight: highlight}, nil
+	case "lab":
+		switch mode {
+		case "76", "2000", "":
+		default:
+			return nil, fmt.Errorf("unknown mode %q (want 76 or 2000)", mode)
+		}
+		return &LabDiffer{Threshold: float64(epsilon), Mode: mode, Highlight: highlight}, nil
+	case "phash":
+		switch hash {
+		case "ahash", "dhash", "phash", "":
+		default:
+			return nil, fmt.Errorf("unknown hash %q (want ahash, dhash or phash)", hash)
+		}
+		return &HashDiffer{Threshold: epsilon, Method: hash, Highlight: highlight}, nil
+	default:
+		return nil, fmt.Errorf("unknown algo %q (want pixel, lab or phash)", algo)
+	}
+}
+
+// parseHighlightColor parses a "RRGGBB" hex string into an opaque color.
+func parseHighlightColor(hex string) (color.RGBA, error) {
+	var r, g, b uint8
+	if _, err := fmt.Sscanf(hex, "%02x%02x%02x", &r, &g, &b); err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid highlight color %q: %w", hex, err)
+	}
+	return color.RGBA{R: r, G: g, B: b, A: 255}, nil
+}
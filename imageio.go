@@ -0,0 +1,28 @@
+package main
+
+import (
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"os"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+)
+
+// loadAndDecodeImage opens filePath and decodes it with whichever codec
+// matches its contents. PNG, JPEG and GIF are handled by the standard
+// library; BMP and TIFF support comes from golang.org/x/image.
+func loadAndDecodeImage(filePath string) (image.Image, error) {
+	imageFile, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer imageFile.Close()
+
+	img, _, err := image.Decode(imageFile)
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
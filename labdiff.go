@@ -0,0 +1,182 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// LabDiffer flags a pixel as different when its CIELAB color distance to
+// the corresponding pixel in the other image exceeds Threshold. Comparing
+// in CIELAB space rather than raw RGB tolerates the small color shifts
+// antialiasing introduces, which a per-channel RGBA delta treats as noise.
+type LabDiffer struct {
+	Threshold float64
+	// Mode selects the distance formula: "76" for the simple Euclidean
+	// CIE76 distance, "2000" for the more perceptually accurate CIEDE2000.
+	// Defaults to "76" when empty.
+	Mode      string
+	Highlight color.RGBA
+}
+
+func (d *LabDiffer) Diff(imgA, imgB image.Image) DiffResult {
+	bounds := imgA.Bounds()
+	out := image.NewRGBA(bounds)
+	count := 0
+	var sumDeltaE float64
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			la, aa, ba := rgbaToLab(imgA.At(x, y))
+			lb, ab, bb := rgbaToLab(imgB.At(x, y))
+
+			var dE float64
+			if d.Mode == "2000" {
+				dE = deltaE2000(la, aa, ba, lb, ab, bb)
+			} else {
+				dE = deltaE76(la, aa, ba, lb, ab, bb)
+			}
+			sumDeltaE += dE
+
+			if dE > d.Threshold {
+				out.Set(x, y, d.Highlight)
+				count++
+			} else {
+				out.Set(x, y, imgB.At(x, y))
+			}
+		}
+	}
+
+	pixelCount := bounds.Dx() * bounds.Dy()
+	meanDeltaE := 0.0
+	if pixelCount > 0 {
+		meanDeltaE = sumDeltaE / float64(pixelCount)
+	}
+
+	return DiffResult{Image: out, PixelDiff: count, MeanDeltaE: meanDeltaE}
+}
+
+// deltaE76 is the Euclidean distance between two CIELAB colors.
+func deltaE76(l1, a1, b1, l2, a2, b2 float64) float64 {
+	dl, da, db := l1-l2, a1-a2, b1-b2
+	return math.Sqrt(dl*dl + da*da + db*db)
+}
+
+// deltaE2000 implements the CIEDE2000 color difference formula.
+func deltaE2000(l1, a1, b1, l2, a2, b2 float64) float64 {
+	c1 := math.Hypot(a1, b1)
+	c2 := math.Hypot(a2, b2)
+	cBar := (c1 + c2) / 2
+
+	g := 0.5 * (1 - math.Sqrt(math.Pow(cBar, 7)/(math.Pow(cBar, 7)+math.Pow(25, 7))))
+	a1p := a1 * (1 + g)
+	a2p := a2 * (1 + g)
+
+	c1p := math.Hypot(a1p, b1)
+	c2p := math.Hypot(a2p, b2)
+
+	h1p := hueAngle(a1p, b1)
+	h2p := hueAngle(a2p, b2)
+
+	dLp := l2 - l1
+	dCp := c2p - c1p
+
+	var dhp float64
+	switch {
+	case c1p*c2p == 0:
+		dhp = 0
+	case math.Abs(h2p-h1p) <= 180:
+		dhp = h2p - h1p
+	case h2p-h1p > 180:
+		dhp = h2p - h1p - 360
+	default:
+		dhp = h2p - h1p + 360
+	}
+	dHp := 2 * math.Sqrt(c1p*c2p) * math.Sin(radians(dhp)/2)
+
+	lBarp := (l1 + l2) / 2
+	cBarp := (c1p + c2p) / 2
+
+	var hBarp float64
+	switch {
+	case c1p*c2p == 0:
+		hBarp = h1p + h2p
+	case math.Abs(h1p-h2p) <= 180:
+		hBarp = (h1p + h2p) / 2
+	case h1p+h2p < 360:
+		hBarp = (h1p + h2p + 360) / 2
+	default:
+		hBarp = (h1p + h2p - 360) / 2
+	}
+
+	t := 1 - 0.17*math.Cos(radians(hBarp-30)) + 0.24*math.Cos(radians(2*hBarp)) +
+		0.32*math.Cos(radians(3*hBarp+6)) - 0.20*math.Cos(radians(4*hBarp-63))
+
+	dTheta := 30 * math.Exp(-math.Pow((hBarp-275)/25, 2))
+	rc := 2 * math.Sqrt(math.Pow(cBarp, 7)/(math.Pow(cBarp, 7)+math.Pow(25, 7)))
+	sl := 1 + (0.015*math.Pow(lBarp-50, 2))/math.Sqrt(20+math.Pow(lBarp-50, 2))
+	sc := 1 + 0.045*cBarp
+	sh := 1 + 0.015*cBarp*t
+	rt := -math.Sin(radians(2*dTheta)) * rc
+
+	return math.Sqrt(
+		math.Pow(dLp/sl, 2) +
+			math.Pow(dCp/sc, 2) +
+			math.Pow(dHp/sh, 2) +
+			rt*(dCp/sc)*(dHp/sh),
+	)
+}
+
+func hueAngle(a, b float64) float64 {
+	if a == 0 && b == 0 {
+		return 0
+	}
+	h := degrees(math.Atan2(b, a))
+	if h < 0 {
+		h += 360
+	}
+	return h
+}
+
+func radians(deg float64) float64 { return deg * math.Pi / 180 }
+func degrees(rad float64) float64 { return rad * 180 / math.Pi }
+
+// rgbaToLab converts a color.Color to CIELAB via the sRGB -> CIEXYZ -> CIELAB
+// pipeline, using the D65 reference white.
+func rgbaToLab(c color.Color) (l, a, b float64) {
+	r8, g8, b8, _ := c.RGBA()
+	r := srgbToLinear(float64(r8) / 65535)
+	g := srgbToLinear(float64(g8) / 65535)
+	bl := srgbToLinear(float64(b8) / 65535)
+
+	x := r*0.4124564 + g*0.3575761 + bl*0.1804375
+	y := r*0.2126729 + g*0.7151522 + bl*0.0721750
+	z := r*0.0193339 + g*0.1191920 + bl*0.9503041
+
+	// D65 reference white
+	const xn, yn, zn = 0.95047, 1.0, 1.08883
+
+	fx := labF(x / xn)
+	fy := labF(y / yn)
+	fz := labF(z / zn)
+
+	l = 116*fy - 16
+	a = 500 * (fx - fy)
+	b = 200 * (fy - fz)
+	return l, a, b
+}
+
+func srgbToLinear(c float64) float64 {
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+func labF(t float64) float64 {
+	const delta = 6.0 / 29.0
+	if t > delta*delta*delta {
+		return math.Cbrt(t)
+	}
+	return t/(3*delta*delta) + 4.0/29.0
+}
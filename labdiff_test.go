@@ -0,0 +1,42 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDeltaE76(t *testing.T) {
+	// Euclidean distance in Lab space, easy to verify by hand: a 3-4-5 triangle.
+	got := deltaE76(0, 0, 0, 0, 3, 4)
+	want := 5.0
+	if math.Abs(got-want) > 1e-9 {
+		t.Fatalf("deltaE76 = %v, want %v", got, want)
+	}
+
+	if got := deltaE76(50, 10, -10, 50, 10, -10); got != 0 {
+		t.Fatalf("deltaE76 of identical colors = %v, want 0", got)
+	}
+}
+
+// TestDeltaE2000 checks deltaE2000 against reference pairs from the Sharma,
+// Wu & Dalal (2005) CIEDE2000 test data set, the standard values used to
+// validate CIEDE2000 implementations.
+func TestDeltaE2000(t *testing.T) {
+	cases := []struct {
+		l1, a1, b1 float64
+		l2, a2, b2 float64
+		want       float64
+	}{
+		{50.0000, 2.6772, -79.7751, 50.0000, 0.0000, -82.7485, 2.0425},
+		{50.0000, 3.1571, -77.2803, 50.0000, 0.0000, -82.7485, 2.8615},
+		{50.0000, -1.3802, -84.2814, 50.0000, 0.0000, -82.7485, 1.0000},
+	}
+
+	for _, c := range cases {
+		got := deltaE2000(c.l1, c.a1, c.b1, c.l2, c.a2, c.b2)
+		if math.Abs(got-c.want) > 5e-3 {
+			t.Errorf("deltaE2000(%v,%v,%v, %v,%v,%v) = %v, want %v",
+				c.l1, c.a1, c.b1, c.l2, c.a2, c.b2, got, c.want)
+		}
+	}
+}
@@ -1,49 +1,115 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"image"
 	"image/draw"
 	"image/png"
-	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
-	"path/filepath"
+	"os/signal"
+	"regexp"
 	"runtime"
-	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sync/errgroup"
 )
 
-// A simple CLI tool that can compare 2 directories of images and output the differences in a 3rd using the ImageMagick compare tool.
+// A simple CLI tool that compares 2 directories of images and outputs the differences in a 3rd,
+// using a native Go pixel-diff engine (see differ.go) instead of shelling out to ImageMagick.
 func main() {
 
 	threads := flag.Int("t", runtime.NumCPU(), "the number of concurrent pages to download")
-	compare := flag.String("compare", "compare", "path to the ImageMagick compare command")
+	algo := flag.String("algo", "pixel", "diff algorithm: pixel, lab or phash")
+	epsilon := flag.Int("epsilon", 32, "max channel/color delta (algo dependent) before a pixel counts as different")
+	mode := flag.String("mode", "76", "CIELAB distance formula for -algo lab: 76 or 2000")
+	hash := flag.String("hash", "ahash", "perceptual hash for -algo phash: ahash, dhash or phash")
+	highlight := flag.String("highlight", "FF00FF", "hex RRGGBB color used to mark differing pixels")
+	align := flag.Int("align", 8, "pixel search window for content-aware alignment before diffing")
+	noAlign := flag.Bool("no-align", false, "disable alignment and compare images as laid out")
+	match := flag.String("match", `\.(jpe?g|png|gif|bmp|tiff?)$`, "regex matched against each file's path relative to the first directory")
+	exclude := flag.String("exclude", "", "glob matched against each file's relative path; matches are skipped")
+	since := flag.String("since", "", "skip files last modified more than this many days ago, e.g. 7d")
+	report := flag.String("report", "", "also write a report in this format: json or html")
+	reportOut := flag.String("report-out", "report", "path (without extension) for the -report file")
+	threshold := flag.Float64("threshold", 0, "exit non-zero when a pair's percent-diff (or hamming distance for phash) exceeds this value; 0 disables")
 
 	flag.Parse()
 
-	args := os.Args
+	args := flag.Args()
 
-	if len(args) != 4 {
-		fmt.Println(os.Args[0], " [directory] [directory] [out dir]\n")
+	if len(args) != 3 {
+		fmt.Println(os.Args[0], " [directory] [directory] [out dir]")
 		flag.Usage()
 		os.Exit(0)
 	}
 
-	dir1 := args[1]
-	dir2 := args[2]
-	outDir := args[3]
+	dir1 := args[0]
+	dir2 := args[1]
+	outDir := args[2]
 
 	os.MkdirAll(outDir, os.ModePerm)
 
-	chIn := grabJobChannelGenerator(*compare, dir1, dir2, outDir)
+	highlightColor, err := parseHighlightColor(*highlight)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	chFiltered := performDiffJobTask(filterDiffJobs, chIn)
+	differ, err := NewDiffer(*algo, *epsilon, *mode, *hash, highlightColor)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	alignWindow := *align
+	if *noAlign {
+		alignWindow = 0
+	}
+
+	matchRegex, err := regexp.Compile(*match)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	sinceTime, err := parseSince(*since)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	walkOpts := WalkOptions{Match: matchRegex, Exclude: *exclude, Since: sinceTime}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	chIn := grabJobChannelGenerator(ctx, differ, alignWindow, walkOpts, dir1, dir2, outDir)
+	chFiltered := performDiffJobTask(ctx, filterDiffJobs, chIn)
 
 	fmt.Println("Compairing images:")
-	for n := range fanDiffJobsIn(fanOut(*threads, diffFiles, chFiltered)...) {
-		fmt.Println("\t", n.outFile)
+	reports, jobErr := processDiffJobs(ctx, *threads, chFiltered)
+	for _, r := range reports {
+		fmt.Println("\t", r.OutFile)
+	}
+
+	printReportTable(reports)
+
+	if *report != "" {
+		if err := writeReport(*report, *reportOut, reports); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if jobErr != nil {
+		log.Fatal(jobErr)
+	}
+
+	if ctx.Err() != nil {
+		os.Exit(1)
+	}
+
+	if *threshold > 0 && anyExceedsThreshold(reports, *threshold) {
+		os.Exit(1)
 	}
 
 }
@@ -52,11 +118,9 @@ func filterDiffJobs(job DiffJob) *DiffJob {
 	if !fileExists(job.inFile1) || !fileExists(job.inFile2) {
 		return nil
 	}
-	return &job
-}
-
-func diffFiles(job DiffJob) *DiffJob {
-	compareFiles(job.comparePath, job.inFile1, job.inFile2, job.outFile)
+	if isDone(job) {
+		return nil
+	}
 	return &job
 }
 
@@ -66,83 +130,79 @@ type DiffJob struct {
 	inFile1     string
 	inFile2     string
 	outFile     string
-	comparePath string
+	differ      Differ
+	alignWindow int
+	report      PairReport
 }
 
 // return a pointer so that nil is a valid result, this allows the filter task to work correctly
 type DiffJobTask func(DiffJob) *DiffJob
 
-func grabJobChannelGenerator(comparePath, inDir1, indDir2, outDir string) <-chan DiffJob {
-	chOut := make(chan DiffJob)
-	go func(inDir1, indDir2, outDir string) {
-		files, err := ioutil.ReadDir(inDir1)
-
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		for _, file := range files {
-			if filepath.Ext(file.Name()) == ".png" {
-				file1 := filepath.Join(inDir1, file.Name())
-				file2 := filepath.Join(indDir2, file.Name())
-				outFile := filepath.Join(outDir, file.Name())
-
-				chOut <- DiffJob{file1, file2, outFile, comparePath}
-			}
-		}
-
-		close(chOut)
-	}(inDir1, indDir2, outDir)
-	return chOut
-}
-
-func fanOut(count int, task DiffJobTask, chIn <-chan DiffJob) []<-chan DiffJob {
-
-	var chFanned []<-chan DiffJob
-
-	for i := 0; i < count; i++ {
-		chFanned = append(chFanned, performDiffJobTask(task, chIn))
-	}
-
-	return chFanned
-}
-
-func performDiffJobTask(task DiffJobTask, chIn <-chan DiffJob) <-chan DiffJob {
+func performDiffJobTask(ctx context.Context, task DiffJobTask, chIn <-chan DiffJob) <-chan DiffJob {
 	chOut := make(chan DiffJob)
 	go func() {
+		defer close(chOut)
 		for grabJob := range chIn {
 			if job := task(grabJob); job != nil {
-				chOut <- *job
+				select {
+				case chOut <- *job:
+				case <-ctx.Done():
+					return
+				}
 			}
 		}
-		close(chOut)
 	}()
 	return chOut
 }
 
-func fanDiffJobsIn(chIns ...<-chan DiffJob) <-chan DiffJob {
-	chOut := make(chan DiffJob)
-
-	var wg sync.WaitGroup
-	wg.Add(len(chIns))
-
+// processDiffJobs runs diffFiles over chIn with at most `threads` jobs in
+// flight at once (an errgroup.SetLimit semaphore), feeding reports back as
+// they complete. chIn and chOut upstream of this function (the caller's
+// generator/filter stages) are unbuffered and ctx-aware on every send, so
+// this loop abandoning chIn on cancellation or a job error unblocks those
+// stages instead of leaking them. It stops taking new jobs as soon as ctx is
+// cancelled (SIGINT/SIGTERM) or a job errors, and returns the reports
+// gathered up to that point along with the first error.
+func processDiffJobs(ctx context.Context, threads int, chIn <-chan DiffJob) ([]PairReport, error) {
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(threads)
+
+	var reports []PairReport
+	chReports := make(chan PairReport, threads*2)
+
+	done := make(chan struct{})
 	go func() {
-		for _, v := range chIns {
-			go func(chIn <-chan DiffJob) {
-				for i := range chIn {
-					chOut <- i
-				}
-				wg.Done()
-			}(v)
+		for r := range chReports {
+			reports = append(reports, r)
 		}
+		close(done)
 	}()
 
-	go func() {
-		wg.Wait()
-		close(chOut)
-	}()
+loop:
+	for {
+		select {
+		case <-gctx.Done():
+			break loop
+		case job, ok := <-chIn:
+			if !ok {
+				break loop
+			}
+			g.Go(func() error {
+				report, err := diffFiles(gctx, job)
+				if err != nil {
+					return err
+				}
+				chReports <- report
+				return nil
+			})
+		}
+	}
 
-	return chOut
+	err := g.Wait()
+	close(chReports)
+	<-done
+
+	return reports, err
 }
 
 // -------------------------------------------------------------------------------------------------------------------------------------------------------------
@@ -156,62 +216,128 @@ func fileExists(path string) bool {
 	return true
 }
 
-func compareFiles(comparePath, in1, in2, outFile string) {
+func diffFiles(ctx context.Context, job DiffJob) (PairReport, error) {
+	report, err := compareFiles(ctx, job.differ, job.alignWindow, job.inFile1, job.inFile2, job.outFile)
+	if err != nil {
+		return PairReport{}, fmt.Errorf("diffing %s and %s: %w", job.inFile1, job.inFile2, err)
+	}
+	markDone(job)
+	return report, nil
+}
+
+func compareFiles(ctx context.Context, differ Differ, alignWindow int, in1, in2, outFile string) (PairReport, error) {
+
+	if err := ctx.Err(); err != nil {
+		return PairReport{}, err
+	}
 
+	start := time.Now()
+
+	// resize the 2 images if necessary; always clean up the scratch file,
+	// even if we bail out early because of an error or cancellation
 	resize := outFile + "tmp"
+	defer os.Remove(resize)
 
-	// resize the 2 images if necessary
-	inA, inB := commonSizeImageLengths(in1, in2, resize)
+	inA, inB, err := commonSizeImageLengths(in1, in2, resize)
+	if err != nil {
+		return PairReport{}, err
+	}
 
-	// compare the 2 images and generate the diff image file
-	cmd := fmt.Sprintf("%s %s %s -highlight-color blue %s", comparePath, inA, inB, outFile)
-	_, err := exec.Command("sh", "-c", cmd).Output()
+	// load the (now equally sized) images and diff them natively
+	img1, err := loadAndDecodeImage(inA)
 	if err != nil {
-		//fmt.Println(out)
-		//fmt.Println(err)
+		return PairReport{}, err
+	}
+	img2, err := loadAndDecodeImage(inB)
+	if err != nil {
+		return PairReport{}, err
 	}
 
-	// load the out file image
-	img1, _ := loadAndDecodePng(inA)
-	img2, _ := loadAndDecodePng(inB)
-	imgDiff, _ := loadAndDecodePng(outFile)
+	// nudge img2 into registration with img1 before diffing, so a shifted or
+	// cropped render doesn't show up as a wall of false-positive pixels
+	if alignWindow > 0 {
+		dx, dy := alignOffset(img1, img2, alignWindow)
+		img2 = translateImage(img2, dx, dy)
+	}
+
+	result := differ.Diff(img1, img2)
 
 	// combine them into a single image for comparison
-	combineImages(img1, imgDiff, img2, outFile)
+	if err := combineImages(img1, result.Image, img2, outFile); err != nil {
+		return PairReport{}, err
+	}
+
+	bounds := img1.Bounds()
+	pixelCount := bounds.Dx() * bounds.Dy()
+	percentDiff := 0.0
+	if pixelCount > 0 {
+		percentDiff = float64(result.PixelDiff) / float64(pixelCount) * 100
+	}
 
-	// remove the outfile
-	os.Remove(resize)
+	return PairReport{
+		InFile1:     in1,
+		InFile2:     in2,
+		OutFile:     outFile,
+		PixelDiff:   result.PixelDiff,
+		PercentDiff: percentDiff,
+		MeanDeltaE:  result.MeanDeltaE,
+		Hamming:     result.Hamming,
+		InSize1:     fileSize(in1),
+		InSize2:     fileSize(in2),
+		OutSize:     fileSize(outFile),
+		Duration:    time.Since(start),
+	}, nil
+}
 
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
 }
 
 // compare the Y length of 2 images and resize the smaller one returning the file paths for the 2 files
-func commonSizeImageLengths(in1, in2, out string) (string, string) {
-	img1, _ := loadAndDecodePng(in1)
-	img2, _ := loadAndDecodePng(in2)
+func commonSizeImageLengths(in1, in2, out string) (string, string, error) {
+	img1, err := loadAndDecodeImage(in1)
+	if err != nil {
+		return "", "", err
+	}
+	img2, err := loadAndDecodeImage(in2)
+	if err != nil {
+		return "", "", err
+	}
 
 	if img1.Bounds().Max.Y > img2.Bounds().Max.Y {
 		// resize img2 since it is shorter
-		resizeImage(img2, img1.Bounds(), out)
-		return in1, out
+		if err := resizeImage(img2, img1.Bounds(), out); err != nil {
+			return "", "", err
+		}
+		return in1, out, nil
 	} else if img2.Bounds().Max.Y > img1.Bounds().Max.Y {
 		// resize img1 since it is shorter
-		resizeImage(img1, img2.Bounds(), out)
-		return out, in2
+		if err := resizeImage(img1, img2.Bounds(), out); err != nil {
+			return "", "", err
+		}
+		return out, in2, nil
 	}
-	return in1, in2
+	return in1, in2, nil
 }
 
-func resizeImage(img1 image.Image, size image.Rectangle, outputFile string) {
+func resizeImage(img1 image.Image, size image.Rectangle, outputFile string) error {
 	newImage := image.NewRGBA(size)
 	draw.Draw(newImage, img1.Bounds(), img1, image.Point{0, 0}, draw.Src)
 
-	toImg, _ := os.Create(outputFile)
+	toImg, err := os.Create(outputFile)
+	if err != nil {
+		return err
+	}
 	defer toImg.Close()
-	png.Encode(toImg, newImage)
+	return png.Encode(toImg, newImage)
 }
 
 // combine 3 images side by side
-func combineImages(img1, img2, img3 image.Image, outputFile string) {
+func combineImages(img1, img2, img3 image.Image, outputFile string) error {
 
 	width := img1.Bounds().Max.X + img2.Bounds().Max.X + img3.Bounds().Max.X
 	height := intMax(intMax(img1.Bounds().Max.Y, img2.Bounds().Max.Y), img3.Bounds().Max.Y)
@@ -224,26 +350,12 @@ func combineImages(img1, img2, img3 image.Image, outputFile string) {
 	draw.Draw(newImage, img2.Bounds().Add(image2Offset), img2, image.Point{0, 0}, draw.Src)
 	draw.Draw(newImage, img3.Bounds().Add(image3Offset), img3, image.Point{0, 0}, draw.Src)
 
-	toImg, _ := os.Create(outputFile)
-	defer toImg.Close()
-	png.Encode(toImg, newImage)
-}
-
-// load a file and decode it into an image object
-func loadAndDecodePng(filePath string) (image.Image, error) {
-
-	imageFile, e := os.Open(filePath)
-	defer imageFile.Close()
-	if e != nil {
-		return nil, e
-	}
-
-	decodedImage, e := png.Decode(imageFile)
-	if e != nil {
-		return nil, e
+	toImg, err := os.Create(outputFile)
+	if err != nil {
+		return err
 	}
-
-	return decodedImage, nil
+	defer toImg.Close()
+	return png.Encode(toImg, newImage)
 }
 
 // int max implementation!
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/bits"
+)
+
+// HashDiffer is a fast "roughly the same" gate built on perceptual hashes
+// rather than a per-pixel comparison. It reduces each image to an 8x8
+// grayscale thumbnail, derives a 64-bit hash (average hash, dHash or pHash)
+// and flags the pair as different once the Hamming distance between the
+// two hashes exceeds Threshold.
+type HashDiffer struct {
+	// Method selects "ahash", "dhash" or "phash". Defaults to "ahash".
+	Method    string
+	Threshold int
+	Highlight color.RGBA
+}
+
+const hashSize = 8
+
+func (d *HashDiffer) Diff(imgA, imgB image.Image) DiffResult {
+	var hashA, hashB uint64
+	switch d.Method {
+	case "dhash":
+		hashA, hashB = dHash(imgA), dHash(imgB)
+	case "phash":
+		hashA, hashB = pHash(imgA), pHash(imgB)
+	default:
+		hashA, hashB = aHash(imgA), aHash(imgB)
+	}
+
+	distance := bits.OnesCount64(hashA ^ hashB)
+
+	bounds := imgA.Bounds()
+	out := image.NewRGBA(bounds)
+	if distance > d.Threshold {
+		draw2Fill(out, d.Highlight)
+	} else {
+		drawCopy(out, imgB)
+	}
+
+	return DiffResult{Image: out, Hamming: distance}
+}
+
+// aHash: mean-threshold an 8x8 grayscale reduction.
+func aHash(img image.Image) uint64 {
+	gray := grayscaleThumbnail(img, hashSize, hashSize)
+
+	var sum int
+	for _, v := range gray {
+		sum += int(v)
+	}
+	mean := sum / len(gray)
+
+	var hash uint64
+	for i, v := range gray {
+		if int(v) >= mean {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash
+}
+
+// dHash: compare each pixel to its right-hand neighbor across a 9x8 reduction.
+func dHash(img image.Image) uint64 {
+	gray := grayscaleThumbnail(img, hashSize+1, hashSize)
+
+	var hash uint64
+	bit := 0
+	for y := 0; y < hashSize; y++ {
+		for x := 0; x < hashSize; x++ {
+			left := gray[y*(hashSize+1)+x]
+			right := gray[y*(hashSize+1)+x+1]
+			if left < right {
+				hash |= 1 << uint(bit)
+			}
+			bit++
+		}
+	}
+	return hash
+}
+
+// pHash: take the low-frequency 8x8 corner of a 32x32 DCT-II and threshold
+// against the median of those coefficients (excluding the DC term).
+func pHash(img image.Image) uint64 {
+	const size = 32
+	gray := grayscaleThumbnail(img, size, size)
+
+	pixels := make([][]float64, size)
+	for y := 0; y < size; y++ {
+		pixels[y] = make([]float64, size)
+		for x := 0; x < size; x++ {
+			pixels[y][x] = float64(gray[y*size+x])
+		}
+	}
+
+	dct := dct2D(pixels, hashSize)
+
+	coeffs := make([]float64, 0, hashSize*hashSize-1)
+	for y := 0; y < hashSize; y++ {
+		for x := 0; x < hashSize; x++ {
+			if x == 0 && y == 0 {
+				continue // skip the DC term
+			}
+			coeffs = append(coeffs, dct[y][x])
+		}
+	}
+	median := medianOf(coeffs)
+
+	var hash uint64
+	bit := 0
+	for y := 0; y < hashSize; y++ {
+		for x := 0; x < hashSize; x++ {
+			if x == 0 && y == 0 {
+				continue
+			}
+			if dct[y][x] >= median {
+				hash |= 1 << uint(bit)
+			}
+			bit++
+		}
+	}
+	return hash
+}
+
+// dct2D computes the keep x keep low-frequency corner of a 2D DCT-II.
+func dct2D(pixels [][]float64, keep int) [][]float64 {
+	n := len(pixels)
+	out := make([][]float64, keep)
+	for u := 0; u < keep; u++ {
+		out[u] = make([]float64, keep)
+		for v := 0; v < keep; v++ {
+			var sum float64
+			for y := 0; y < n; y++ {
+				for x := 0; x < n; x++ {
+					sum += pixels[y][x] *
+						math.Cos(math.Pi/float64(n)*(float64(x)+0.5)*float64(v)) *
+						math.Cos(math.Pi/float64(n)*(float64(y)+0.5)*float64(u))
+				}
+			}
+			out[u][v] = sum
+		}
+	}
+	return out
+}
+
+func medianOf(vals []float64) float64 {
+	sorted := append([]float64(nil), vals...)
+	for i := 1; i < len(sorted); i++ {
+		for j := i; j > 0 && sorted[j-1] > sorted[j]; j-- {
+			sorted[j-1], sorted[j] = sorted[j], sorted[j-1]
+		}
+	}
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// grayscaleThumbnail nearest-neighbor resamples img to w x h and returns its
+// luma values in row-major order.
+func grayscaleThumbnail(img image.Image, w, h int) []uint8 {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	out := make([]uint8, w*h)
+	for y := 0; y < h; y++ {
+		srcY := bounds.Min.Y + y*srcH/h
+		for x := 0; x < w; x++ {
+			srcX := bounds.Min.X + x*srcW/w
+			gray := color.GrayModel.Convert(img.At(srcX, srcY)).(color.Gray)
+			out[y*w+x] = gray.Y
+		}
+	}
+	return out
+}
+
+func draw2Fill(img *image.RGBA, c color.RGBA) {
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			img.Set(x, y, c)
+		}
+	}
+}
+
+func drawCopy(dst *image.RGBA, src image.Image) {
+	bounds := src.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			dst.Set(x, y, src.At(x, y))
+		}
+	}
+}
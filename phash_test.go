@@ -0,0 +1,74 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math/bits"
+	"testing"
+)
+
+// checkerboard returns a grayscale image alternating black/white in
+// quadrant-sized blocks, giving aHash/dHash something with both a clear
+// mean and clear left-right edges to key off.
+func checkerboard(w, h int, invert bool) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			black := (x/(w/2)+y/(h/2))%2 == 0
+			if invert {
+				black = !black
+			}
+			v := uint8(255)
+			if black {
+				v = 0
+			}
+			img.SetGray(x, y, color.Gray{Y: v})
+		}
+	}
+	return img
+}
+
+func TestAHashIdenticalAndInverted(t *testing.T) {
+	img := checkerboard(64, 64, false)
+	inverted := checkerboard(64, 64, true)
+
+	if d := bits.OnesCount64(aHash(img) ^ aHash(img)); d != 0 {
+		t.Fatalf("aHash of identical images has distance %d, want 0", d)
+	}
+
+	d := bits.OnesCount64(aHash(img) ^ aHash(inverted))
+	if d < 32 {
+		t.Fatalf("aHash of inverted images has distance %d, want a large (>=32) distance", d)
+	}
+}
+
+// gradient returns a grayscale image whose value increases monotonically
+// left-to-right, giving dHash (which keys off left-vs-right-neighbor
+// comparisons) a consistent sign to flip on inversion.
+func gradient(w, h int, invert bool) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8(x * 255 / (w - 1))
+			if invert {
+				v = 255 - v
+			}
+			img.SetGray(x, y, color.Gray{Y: v})
+		}
+	}
+	return img
+}
+
+func TestDHashIdenticalAndInverted(t *testing.T) {
+	img := gradient(64, 64, false)
+	inverted := gradient(64, 64, true)
+
+	if d := bits.OnesCount64(dHash(img) ^ dHash(img)); d != 0 {
+		t.Fatalf("dHash of identical images has distance %d, want 0", d)
+	}
+
+	d := bits.OnesCount64(dHash(img) ^ dHash(inverted))
+	if d < 32 {
+		t.Fatalf("dHash of inverted images has distance %d, want a large (>=32) distance", d)
+	}
+}
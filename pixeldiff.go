@@ -0,0 +1,56 @@
+package main
+
+import (
+	"image"
+	"image/color"
+)
+
+// PixelDiffer flags a pixel as different when the largest of its R, G, B or
+// A channel deltas exceeds Epsilon (0-255).
+type PixelDiffer struct {
+	Epsilon   int
+	Highlight color.RGBA
+}
+
+func (d *PixelDiffer) Diff(imgA, imgB image.Image) DiffResult {
+	bounds := imgA.Bounds()
+	out := image.NewRGBA(bounds)
+	count := 0
+
+	threshold := uint32(d.Epsilon) * 0x101 // scale 0-255 into the 0-65535 range used by color.RGBA()
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			ar, ag, ab, aa := imgA.At(x, y).RGBA()
+			br, bg, bb, ba := imgB.At(x, y).RGBA()
+
+			delta := maxUint32(absDiff(ar, br), absDiff(ag, bg), absDiff(ab, bb), absDiff(aa, ba))
+
+			if delta > threshold {
+				out.Set(x, y, d.Highlight)
+				count++
+			} else {
+				out.Set(x, y, imgB.At(x, y))
+			}
+		}
+	}
+
+	return DiffResult{Image: out, PixelDiff: count}
+}
+
+func absDiff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+func maxUint32(vals ...uint32) uint32 {
+	m := vals[0]
+	for _, v := range vals[1:] {
+		if v > m {
+			m = v
+		}
+	}
+	return m
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// PairReport captures the metrics gathered while diffing a single pair of
+// input files: how different they are, how big the inputs/output are, and
+// how long the comparison took.
+type PairReport struct {
+	InFile1     string        `json:"inFile1"`
+	InFile2     string        `json:"inFile2"`
+	OutFile     string        `json:"outFile"`
+	PixelDiff   int           `json:"pixelDiff"`
+	PercentDiff float64       `json:"percentDiff"`
+	MeanDeltaE  float64       `json:"meanDeltaE"`
+	Hamming     int           `json:"hamming"`
+	InSize1     int64         `json:"inSize1"`
+	InSize2     int64         `json:"inSize2"`
+	OutSize     int64         `json:"outSize"`
+	Duration    time.Duration `json:"durationNs"`
+}
+
+// anyExceedsThreshold reports whether any pair's percent-diff or hamming
+// distance is over threshold, for use as a CI visual-regression gate.
+func anyExceedsThreshold(reports []PairReport, threshold float64) bool {
+	for _, r := range reports {
+		if r.PercentDiff > threshold || float64(r.Hamming) > threshold {
+			return true
+		}
+	}
+	return false
+}
+
+// printReportTable prints a human-readable summary table to stdout.
+func printReportTable(reports []PairReport) {
+	if len(reports) == 0 {
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+	fmt.Fprintln(w, "\nout file\tpixel diff\t% diff\tmean dE\thamming\tin1\tin2\tout\ttime")
+	for _, r := range reports {
+		fmt.Fprintf(w, "%s\t%d\t%.2f%%\t%.2f\t%d\t%s\t%s\t%s\t%s\n",
+			r.OutFile, r.PixelDiff, r.PercentDiff, r.MeanDeltaE, r.Hamming,
+			humanSize(r.InSize1), humanSize(r.InSize2), humanSize(r.OutSize), r.Duration.Round(time.Millisecond))
+	}
+	w.Flush()
+}
+
+// writeReport writes reports to path+".json" or path+".html" depending on format.
+func writeReport(format, path string, reports []PairReport) error {
+	switch format {
+	case "json":
+		return writeJSONReport(path+".json", reports)
+	case "html":
+		return writeHTMLReport(path+".html", reports)
+	default:
+		return fmt.Errorf("unknown report format %q (want json or html)", format)
+	}
+}
+
+func writeJSONReport(path string, reports []PairReport) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(reports)
+}
+
+// humanSize formats a byte count like "1.2 MiB".
+func humanSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"humanSize": humanSize,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>idiff report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border: 1px solid #ccc; padding: 6px 10px; text-align: left; }
+th { cursor: pointer; background: #f0f0f0; }
+img { max-width: 320px; display: block; }
+</style>
+</head>
+<body>
+<h1>idiff report</h1>
+<table id="report">
+<thead>
+<tr><th>out file</th><th>pixel diff</th><th>% diff</th><th>mean dE</th><th>hamming</th><th>out size</th><th>preview</th></tr>
+</thead>
+<tbody>
+{{range .}}
+<tr>
+<td>{{.OutFile}}</td>
+<td>{{.PixelDiff}}</td>
+<td>{{printf "%.2f" .PercentDiff}}%</td>
+<td>{{printf "%.2f" .MeanDeltaE}}</td>
+<td>{{.Hamming}}</td>
+<td>{{humanSize .OutSize}}</td>
+<td><img src="{{.ImageData}}" alt="diff"></td>
+</tr>
+{{end}}
+</tbody>
+</table>
+<script>
+document.querySelectorAll("th").forEach(function(th, i) {
+	th.addEventListener("click", function() {
+		var rows = Array.from(document.querySelectorAll("#report tbody tr"));
+		var asc = th.dataset.asc !== "true";
+		th.dataset.asc = asc;
+		rows.sort(function(a, b) {
+			var av = a.children[i].innerText, bv = b.children[i].innerText;
+			var an = parseFloat(av), bn = parseFloat(bv);
+			var cmp = (!isNaN(an) && !isNaN(bn)) ? an - bn : av.localeCompare(bv);
+			return asc ? cmp : -cmp;
+		});
+		rows.forEach(function(r) { r.parentNode.appendChild(r); });
+	});
+});
+</script>
+</body>
+</html>
+`))
+
+// htmlReportRow adds the base64-encoded thumbnail the template renders to a
+// PairReport, so the generated page doesn't depend on OutFile staying
+// reachable at a path relative to wherever the page is later opened from.
+type htmlReportRow struct {
+	PairReport
+	ImageData template.URL
+}
+
+// writeHTMLReport writes a self-contained HTML page with a sortable table
+// and a thumbnail of each pair's three-panel diff image, embedded as a
+// base64 data URI so the report keeps working if it's moved or opened from
+// somewhere other than -report-out's directory.
+func writeHTMLReport(path string, reports []PairReport) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rows := make([]htmlReportRow, len(reports))
+	for i, r := range reports {
+		rows[i] = htmlReportRow{PairReport: r, ImageData: imageDataURI(r.OutFile)}
+	}
+
+	return htmlReportTemplate.Execute(f, rows)
+}
+
+// imageDataURI reads path and returns it as a "data:image/png;base64,..."
+// URI, or "" if it can't be read (e.g. the diff image is missing).
+func imageDataURI(path string) template.URL {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(data))
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WalkOptions configures how grabJobChannelGenerator discovers pairs to diff.
+type WalkOptions struct {
+	// Match is applied to each file's relative path; only matches are diffed.
+	Match *regexp.Regexp
+	// Exclude is a glob matched against each file's relative path; matches are skipped.
+	Exclude string
+	// Since, when non-zero, skips files last modified before this time.
+	Since time.Time
+}
+
+const doneMarkerSuffix = ".idiff-done"
+const ignoreFileName = ".idiffignore"
+
+// grabJobChannelGenerator recursively walks inDir1, mirroring its subdirectory
+// structure into outDir, and emits a DiffJob for every file under inDir1 that
+// matches opts.Match, isn't excluded by opts.Exclude or a .idiffignore file in
+// its directory, and isn't older than opts.Since. Pairs with a fresh
+// .idiff-done marker from a previous run are left for filterDiffJobs to skip.
+// The walk stops as soon as ctx is cancelled.
+func grabJobChannelGenerator(ctx context.Context, differ Differ, alignWindow int, opts WalkOptions, inDir1, inDir2, outDir string) <-chan DiffJob {
+	chOut := make(chan DiffJob)
+	go func() {
+		defer close(chOut)
+
+		ignores := map[string][]string{}
+
+		err := filepath.WalkDir(inDir1, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if d.IsDir() {
+				return nil
+			}
+
+			rel, err := filepath.Rel(inDir1, path)
+			if err != nil {
+				return err
+			}
+
+			if opts.Match != nil && !opts.Match.MatchString(rel) {
+				return nil
+			}
+			if opts.Exclude != "" {
+				if matched, _ := filepath.Match(opts.Exclude, rel); matched {
+					return nil
+				}
+				if matched, _ := filepath.Match(opts.Exclude, filepath.Base(rel)); matched {
+					return nil
+				}
+			}
+			if isIgnored(ignores, inDir1, rel) {
+				return nil
+			}
+			if !opts.Since.IsZero() {
+				info, err := d.Info()
+				if err != nil {
+					return err
+				}
+				if info.ModTime().Before(opts.Since) {
+					return nil
+				}
+			}
+
+			file1 := path
+			file2 := filepath.Join(inDir2, rel)
+			outFile := filepath.Join(outDir, rel)
+
+			os.MkdirAll(filepath.Dir(outFile), os.ModePerm)
+
+			select {
+			case chOut <- DiffJob{inFile1: file1, inFile2: file2, outFile: outFile, differ: differ, alignWindow: alignWindow}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			return nil
+		})
+
+		if err != nil && err != context.Canceled {
+			log.Fatal(err)
+		}
+	}()
+	return chOut
+}
+
+// isIgnored reports whether rel (relative to root) matches a pattern in the
+// nearest .idiffignore file above it, gitignore-style: one glob per line,
+// blank lines and lines starting with '#' are skipped.
+func isIgnored(cache map[string][]string, root, rel string) bool {
+	dir := filepath.Dir(rel)
+	for {
+		patterns, ok := cache[dir]
+		if !ok {
+			patterns = loadIgnorePatterns(filepath.Join(root, dir, ignoreFileName))
+			cache[dir] = patterns
+		}
+
+		// relToDir is rel re-rooted at dir, i.e. the path a pattern in dir's
+		// own .idiffignore would expect to match, not the walk-root-relative path.
+		relToDir, err := filepath.Rel(dir, rel)
+		if err != nil {
+			relToDir = rel
+		}
+
+		base := filepath.Base(rel)
+		for _, pattern := range patterns {
+			if matched, _ := filepath.Match(pattern, base); matched {
+				return true
+			}
+			if matched, _ := filepath.Match(pattern, relToDir); matched {
+				return true
+			}
+		}
+
+		if dir == "." || dir == string(filepath.Separator) {
+			return false
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func loadIgnorePatterns(path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns
+}
+
+// parseSince parses the -since flag, e.g. "7d", into the cutoff time before
+// which files are skipped.
+func parseSince(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Now().AddDate(0, 0, -days), nil
+}
+
+// doneMarkerPath returns the sentinel path written alongside outFile once it
+// has been successfully diffed.
+func doneMarkerPath(outFile string) string {
+	return outFile + doneMarkerSuffix
+}
+
+// isDone reports whether job's done marker already exists and is newer than
+// both input files, meaning this pair was diffed by a previous run and
+// neither input has changed since.
+func isDone(job DiffJob) bool {
+	markerInfo, err := os.Stat(doneMarkerPath(job.outFile))
+	if err != nil {
+		return false
+	}
+
+	in1Info, err := os.Stat(job.inFile1)
+	if err != nil || in1Info.ModTime().After(markerInfo.ModTime()) {
+		return false
+	}
+	in2Info, err := os.Stat(job.inFile2)
+	if err != nil || in2Info.ModTime().After(markerInfo.ModTime()) {
+		return false
+	}
+	return true
+}
+
+// markDone writes job's done marker so a re-run can skip it.
+func markDone(job DiffJob) {
+	f, err := os.Create(doneMarkerPath(job.outFile))
+	if err != nil {
+		return
+	}
+	f.Close()
+}